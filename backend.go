@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+)
+
+// openBackend resolves the -backend flag (plus the positional dir argument
+// for the local backend) into an fs.FS, so the rest of the tool can walk
+// and read any storage system through the same interface.
+func openBackend(backend, dir string) (fs.FS, error) {
+	switch {
+	case backend == "" || backend == "local":
+		return &localFS{root: dir}, nil
+	case backend == "mapfs":
+		return newFixtureMapFS(), nil
+	case strings.HasPrefix(backend, "s3://"):
+		return newS3FS(strings.TrimPrefix(backend, "s3://"))
+	case strings.HasPrefix(backend, "sftp://"):
+		return newSFTPFS(strings.TrimPrefix(backend, "sftp://"))
+	default:
+		return nil, fmt.Errorf("unknown backend %q", backend)
+	}
+}
+
+// localFS is the fs.FS backend for local disk. It's a thin wrapper around
+// os.DirFS that additionally exposes OpenForRead, so -direct and -fadvise
+// keep working through the fs.FS abstraction.
+type localFS struct {
+	root string
+}
+
+// Open opens name plainly, with no cache-control flags applied. fs.WalkDir
+// uses this to descend into directories (including "."), and -direct's
+// O_DIRECT doesn't work on directory fds -- OpenForRead is the path that
+// honors -direct/-fadvise, for the per-file reads that actually want them.
+func (l *localFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.Join(l.root, name))
+}
+
+// OpenForRead opens name honoring the cache-control flags. It's used by
+// openForRead for any backend that implements it.
+func (l *localFS) OpenForRead(name string) (fs.File, error) {
+	return openLocalForRead(filepath.Join(l.root, name))
+}
+
+// cacheAwareFS is implemented by backends whose Open already honors
+// -direct/-fadvise, so openForRead doesn't need to special-case them.
+type cacheAwareFS interface {
+	fs.FS
+	OpenForRead(name string) (fs.File, error)
+}
+
+// openForRead opens name from fsys, applying cache-control flags when the
+// backend supports them.
+func openForRead(fsys fs.FS, name string) (fs.File, error) {
+	if cfs, ok := fsys.(cacheAwareFS); ok {
+		return cfs.OpenForRead(name)
+	}
+
+	return fsys.Open(name)
+}
+
+// newFixtureMapFS builds a small, deterministic in-memory file set for
+// CI-reproducible microbenchmarks that don't depend on the local disk.
+func newFixtureMapFS() fstest.MapFS {
+	files := fstest.MapFS{}
+	for i := 0; i < 256; i++ {
+		name := fmt.Sprintf("file-%03d", i)
+		files[name] = &fstest.MapFile{
+			Data: bytes.Repeat([]byte{byte(i)}, 4096),
+			Mode: 0644,
+		}
+	}
+
+	return files
+}
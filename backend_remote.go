@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// dirEntry is a trivial fs.DirEntry for backends (S3, SFTP) that already
+// have an fs.FileInfo in hand and just need it wrapped.
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.Name() }
+func (d dirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d dirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+// sshAgentConn connects to the ssh-agent referenced by SSH_AUTH_SOCK.
+func sshAgentConn() (net.Conn, error) {
+	return net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+}
+
+// currentUser returns the local username, used as the SFTP login name.
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "root"
+	}
+
+	return u.Username
+}
+
+// s3FS is the fs.FS backend for an S3 bucket/prefix, selected via
+// -backend=s3://bucket/prefix.
+type s3FS struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// newS3FS parses "bucket/prefix" (the s3:// scheme already stripped by the
+// caller) and builds a client from the default AWS credential chain.
+func newS3FS(location string) (fs.FS, error) {
+	bucket, prefix, _ := strings.Cut(location, "/")
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	return &s3FS{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *s3FS) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *s3FS) Open(name string) (fs.File, error) {
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteFile{name: name, size: aws.ToInt64(out.ContentLength), rc: out.Body}, nil
+}
+
+// ReadDir lists objects under prefix one directory level at a time, so
+// fs.WalkDir can traverse a bucket the same way it traverses a disk.
+func (s *s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := s.key(name)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var entries []fs.DirEntry
+	var token *string
+
+	for {
+		out, err := s.client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(prefix),
+			Delimiter:         aws.String("/"),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing %v: %w", name, err)
+		}
+
+		for _, p := range out.CommonPrefixes {
+			dirName := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(p.Prefix), prefix), "/")
+			entries = append(entries, dirEntry{remoteFileInfo{name: dirName, isDir: true}})
+		}
+
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if key == prefix {
+				continue
+			}
+
+			entries = append(entries, dirEntry{remoteFileInfo{
+				name: strings.TrimPrefix(key, prefix),
+				size: aws.ToInt64(obj.Size),
+			}})
+		}
+
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+
+		token = out.NextContinuationToken
+	}
+
+	return entries, nil
+}
+
+// sftpFS is the fs.FS backend for a remote host/path reachable over SFTP,
+// selected via -backend=sftp://host/path.
+type sftpFS struct {
+	client *sftp.Client
+	root   string
+}
+
+// newSFTPFS dials host using the local SSH agent for authentication and
+// opens an SFTP session rooted at path.
+func newSFTPFS(location string) (fs.FS, error) {
+	host, root, _ := strings.Cut(location, "/")
+
+	sock, err := sshAgentConn()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to ssh-agent: %w", err)
+	}
+
+	conn, err := ssh.Dial("tcp", host+":22", &ssh.ClientConfig{
+		User:            currentUser(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(sock).Signers)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dialing %v: %w", host, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, fmt.Errorf("starting sftp session: %w", err)
+	}
+
+	return &sftpFS{client: client, root: root}, nil
+}
+
+func (s *sftpFS) Open(name string) (fs.File, error) {
+	return s.client.Open(path.Join(s.root, name))
+}
+
+// ReadDir lists name's children over SFTP. *sftp.Client has no Open result
+// that implements fs.ReadDirFile, so fs.WalkDir needs this method directly.
+func (s *sftpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.client.ReadDir(path.Join(s.root, name))
+	if err != nil {
+		return nil, fmt.Errorf("reading dir %v: %w", name, err)
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+
+	return entries, nil
+}
+
+// remoteFile adapts an io.ReadCloser plus a known size to fs.File, for
+// backends (like S3) whose objects aren't already *os.File.
+type remoteFile struct {
+	name string
+	size int64
+	rc   interface {
+		Read([]byte) (int, error)
+		Close() error
+	}
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return remoteFileInfo{name: f.name, size: f.size}, nil
+}
+func (f *remoteFile) Read(p []byte) (int, error) { return f.rc.Read(p) }
+func (f *remoteFile) Close() error               { return f.rc.Close() }
+
+type remoteFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (fi remoteFileInfo) Name() string { return fi.name }
+func (fi remoteFileInfo) Size() int64  { return fi.size }
+
+func (fi remoteFileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+func (fi remoteFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi remoteFileInfo) IsDir() bool        { return fi.isDir }
+func (fi remoteFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var fadviseAdvice = map[string]int{
+	"sequential": unix.FADV_SEQUENTIAL,
+	"random":     unix.FADV_RANDOM,
+	"dontneed":   unix.FADV_DONTNEED,
+}
+
+// warnUnsupportedCacheFlags is a no-op on linux, where -direct and -fadvise
+// are both supported.
+func warnUnsupportedCacheFlags() {}
+
+// openLocalForRead opens the local path filename for reading, honoring
+// -direct and -fadvise.
+func openLocalForRead(filename string) (*os.File, error) {
+	flags := os.O_RDONLY
+	if direct {
+		flags |= syscall.O_DIRECT
+	}
+
+	f, err := os.OpenFile(filename, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if advice, ok := fadviseAdvice[fadviseMode]; ok {
+		if err := unix.Fadvise(int(f.Fd()), 0, 0, advice); err != nil {
+			fmt.Fprintf(os.Stderr, "fadvise %v on %v failed: %v\n", fadviseMode, filename, err)
+		}
+	}
+
+	return f, nil
+}
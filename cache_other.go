@@ -0,0 +1,29 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// warnUnsupportedCacheFlags is called once from init(), before any worker
+// goroutines start, since -direct and -fadvise are Linux only here.
+func warnUnsupportedCacheFlags() {
+	if direct {
+		fmt.Fprintf(os.Stderr, "warning: -direct is only supported on linux, ignoring\n")
+		direct = false
+	}
+
+	if fadviseMode != "none" {
+		fmt.Fprintf(os.Stderr, "warning: -fadvise is only supported on linux, ignoring\n")
+		fadviseMode = "none"
+	}
+}
+
+// openLocalForRead opens the local path filename for reading. It's called
+// concurrently by every worker, so unlike warnUnsupportedCacheFlags it must
+// not touch the direct/fadviseMode flags.
+func openLocalForRead(filename string) (*os.File, error) {
+	return os.Open(filename)
+}
@@ -4,11 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
@@ -16,19 +18,82 @@ var (
 	workers           int
 	reportingInterval time.Duration
 	outputFile        string
+	mode              string
+	readSize          int
+	offsetMode        string
+	duration          time.Duration
+	direct            bool
+	fadviseMode       string
+	dropCaches        bool
+	backend           string
+	sweep             string
+	sweepThreshold    float64
 )
 
 func init() {
 	flag.IntVar(&workers, "workers", 2, "set number of workers reading files concurrently")
 	flag.DurationVar(&reportingInterval, "interval", 10*time.Second, "set reporting interval")
 	flag.StringVar(&outputFile, "output", "benchmarks.csv", "set output file")
-	flag.Parse()
+	flag.StringVar(&mode, "mode", "read", "set benchmark mode (read, stat, open, randomio)")
+	flag.IntVar(&readSize, "read-size", 4096, "set read size in bytes for randomio mode")
+	flag.StringVar(&offsetMode, "offset", "sequential", "set offset pattern for randomio mode (sequential, random)")
+	flag.DurationVar(&duration, "duration", 10*time.Second, "set wall-clock duration for randomio mode")
+	flag.BoolVar(&direct, "direct", false, "open files with O_DIRECT on Linux (warns and falls back elsewhere)")
+	flag.StringVar(&fadviseMode, "fadvise", "none", "apply fadvise after open (none, sequential, random, dontneed)")
+	flag.BoolVar(&dropCaches, "drop-caches", false, "write to /proc/sys/vm/drop_caches before the run (requires root, linux only)")
+	flag.StringVar(&backend, "backend", "local", "set storage backend (local, mapfs, s3://bucket/prefix, sftp://host/path)")
+	flag.StringVar(&sweep, "sweep", "", "comma-separated list of worker counts to run in sequence, e.g. 1,2,4,8,16,32")
+	flag.Float64Var(&sweepThreshold, "sweep-threshold", 0.1, "minimum relative bandwidth gain between sweep steps before reporting the knee")
+}
+
+// warnCacheFlagsUnsupportedByBackend resets -direct/-fadvise for any backend
+// other than local, since only localFS implements OpenForRead -- openForRead
+// silently falls back to a plain Open for the rest, so cacheMode() must not
+// go on claiming they're in effect.
+func warnCacheFlagsUnsupportedByBackend() {
+	if backend == "" || backend == "local" {
+		return
+	}
+
+	if direct {
+		fmt.Fprintf(os.Stderr, "warning: -direct is only supported on the local backend, ignoring\n")
+		direct = false
+	}
+
+	if fadviseMode != "none" {
+		fmt.Fprintf(os.Stderr, "warning: -fadvise is only supported on the local backend, ignoring\n")
+		fadviseMode = "none"
+	}
+}
+
+// cacheMode summarizes the cache-control options in effect, so CSV rows
+// produced with different settings stay distinguishable.
+func cacheMode() string {
+	mode := "page-cache"
+	if direct {
+		mode = "direct"
+	}
+
+	if fadviseMode != "none" {
+		mode += "+fadvise-" + fadviseMode
+	}
+
+	return mode
+}
+
+// dropPageCache asks the kernel to drop clean caches, so back-to-back runs
+// over the same directory don't just measure page cache throughput.
+func dropPageCache() error {
+	return ioutil.WriteFile("/proc/sys/vm/drop_caches", []byte("3\n"), 0644)
 }
 
 // Stats collect statistics about what has been seen.
 type Stats struct {
-	files, dirs int
-	bytes       int64
+	files, dirs      int
+	bytes            int64
+	statOps, openOps int
+	readOps, ioOps   int
+	latencies        []time.Duration
 }
 
 // Add adds all the stats from other.
@@ -36,79 +101,182 @@ func (s *Stats) Add(other Stats) {
 	s.files += other.files
 	s.dirs += other.dirs
 	s.bytes += other.bytes
+	s.statOps += other.statOps
+	s.openOps += other.openOps
+	s.readOps += other.readOps
+	s.ioOps += other.ioOps
+	s.latencies = append(s.latencies, other.latencies...)
 }
 
-func readFile(wg *sync.WaitGroup, ch chan string, stats chan<- Stats) {
+// Percentile returns the latency at the given percentile (0..100). The
+// passed slice must already be sorted in ascending order.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	idx := int(p / 100 * float64(len(sorted)-1))
+	return sorted[idx]
+}
+
+// operation processes a single file from fsys and returns the Stats
+// collected for it.
+type operation func(fsys fs.FS, filename string) (Stats, error)
+
+// selectOperation returns the per-file operation for the given mode.
+func selectOperation(mode string) (operation, error) {
+	switch mode {
+	case "read":
+		return readFile, nil
+	case "stat":
+		return statFile, nil
+	case "open":
+		return openFile, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+func readFile(fsys fs.FS, filename string) (Stats, error) {
+	start := time.Now()
+
+	f, err := openForRead(fsys, filename)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	n, err := io.Copy(ioutil.Discard, f)
+	if err != nil {
+		_ = f.Close()
+		return Stats{}, err
+	}
+
+	if err = f.Close(); err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		files:     1,
+		bytes:     n,
+		readOps:   1,
+		latencies: []time.Duration{time.Since(start)},
+	}, nil
+}
+
+func statFile(fsys fs.FS, filename string) (Stats, error) {
+	start := time.Now()
+
+	if _, err := fs.Stat(fsys, filename); err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		files:     1,
+		statOps:   1,
+		latencies: []time.Duration{time.Since(start)},
+	}, nil
+}
+
+func openFile(fsys fs.FS, filename string) (Stats, error) {
+	start := time.Now()
+
+	f, err := openForRead(fsys, filename)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if err = f.Close(); err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		files:     1,
+		openOps:   1,
+		latencies: []time.Duration{time.Since(start)},
+	}, nil
+}
+
+func worker(id int, wg *sync.WaitGroup, fsys fs.FS, ch chan string, stats chan<- Stats, op operation, progress *ProgressBars) {
 	defer wg.Done()
-	last := time.Now()
 	for filename := range ch {
-		if time.Since(last) > reportingInterval {
-			fmt.Fprintf(os.Stderr, "read %v\n", filename)
-			last = time.Now()
-		}
-
-		f, err := os.Open(filename)
+		s, err := op(fsys, filename)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "unable to read %v: %v\n", filename, err)
+			fmt.Fprintf(os.Stderr, "unable to process %v: %v\n", filename, err)
 			continue
 		}
 
-		n, err := io.Copy(ioutil.Discard, f)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading %v: %v\n", filename, err)
-			_ = f.Close()
-			continue
-		}
+		progress.Add(id, int64(s.files), s.bytes)
+		stats <- s
+	}
+}
 
-		err = f.Close()
+// countFiles walks fsys once just to count the regular files in it, so
+// traverse can report progress against an accurate total.
+func countFiles(fsys fs.FS) (count int, err error) {
+	err = fs.WalkDir(fsys, ".", func(item string, d fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error closing %v: %v\n", filename, err)
-			continue
+			return err
 		}
 
-		stats <- Stats{
-			files: 1,
-			bytes: n,
+		if d.Type().IsRegular() {
+			count++
 		}
-	}
+
+		return nil
+	})
+
+	return count, err
 }
 
-func walk(dir string, ch chan string, stats chan<- Stats) {
+// walk feeds ch with every regular file found in fsys and returns the
+// directory count together with any error fs.WalkDir hit -- a caller that
+// ignores the error would have no way to tell "no files" from "didn't
+// actually walk anything".
+func walk(fsys fs.FS, ch chan string, stats chan<- Stats) error {
 	defer close(ch)
 	dirs := 0
-	err := filepath.Walk(dir, func(item string, fi os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, ".", func(item string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if fi.Mode().IsRegular() {
+		if d.Type().IsRegular() {
 			ch <- item
 		}
 
-		if fi.IsDir() {
+		if d.IsDir() {
 			dirs++
 		}
 
 		return nil
 	})
 
+	stats <- Stats{dirs: dirs}
+
+	return err
+}
+
+func traverse(workers int, fsys fs.FS, op operation) (stats Stats, err error) {
+	total, err := countFiles(fsys)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error walking %v: %v\n", dir, err)
+		return Stats{}, fmt.Errorf("counting files: %w", err)
 	}
 
-	stats <- Stats{dirs: dirs}
-}
+	progress := NewProgressBars(workers, total)
+	go progress.Run(reportingInterval)
 
-func traverse(workers int, dir string) (stats Stats) {
 	var wg sync.WaitGroup
 	var ch = make(chan string, 100)
 	var statsCh = make(chan Stats, 100)
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go readFile(&wg, ch, statsCh)
+		go worker(i, &wg, fsys, ch, statsCh, op, progress)
 	}
 
-	go walk(dir, ch, statsCh)
+	walkErrCh := make(chan error, 1)
+	go func() {
+		walkErrCh <- walk(fsys, ch, statsCh)
+	}()
 
 	var statsWg sync.WaitGroup
 	statsWg.Add(1)
@@ -123,8 +291,13 @@ func traverse(workers int, dir string) (stats Stats) {
 	close(statsCh)
 
 	statsWg.Wait()
+	progress.Stop()
 
-	return stats
+	if err := <-walkErrCh; err != nil {
+		return stats, fmt.Errorf("walking: %w", err)
+	}
+
+	return stats, nil
 }
 
 func formatBytes(c uint64) string {
@@ -144,41 +317,165 @@ func formatBytes(c uint64) string {
 	}
 }
 
+// parseSweep parses a comma-separated list of worker counts, e.g. "1,2,4".
+func parseSweep(s string) ([]int, error) {
+	var counts []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid worker count %q: %w", part, err)
+		}
+
+		counts = append(counts, n)
+	}
+
+	return counts, nil
+}
+
+// runOnce runs a single benchmark pass with the given number of workers and
+// returns the collected Stats together with the wall-clock time it took.
+func runOnce(workersN int, fsys fs.FS) (stats Stats, sec float64, err error) {
+	if dropCaches {
+		if err := dropPageCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to drop caches: %v\n", err)
+		}
+	}
+
+	start := time.Now()
+
+	if mode == "randomio" {
+		stats, err = benchmarkRandomIO(workersN, fsys, readSize, offsetMode, duration)
+	} else {
+		var op operation
+		op, err = selectOperation(mode)
+		if err == nil {
+			stats, err = traverse(workersN, fsys, op)
+		}
+	}
+
+	return stats, float64(time.Since(start)) / float64(time.Second), err
+}
+
+// report prints a summary of stats to stderr and appends one row to f,
+// returning the achieved bandwidth in bytes/sec for sweep comparisons.
+func report(f *os.File, workersN int, stats Stats, sec float64) float64 {
+	bps := float64(stats.bytes) / sec
+	iops := float64(stats.ioOps) / sec
+
+	sort.Slice(stats.latencies, func(i, j int) bool {
+		return stats.latencies[i] < stats.latencies[j]
+	})
+
+	var p50, p90, p99, max time.Duration
+	if n := len(stats.latencies); n > 0 {
+		p50 = Percentile(stats.latencies, 50)
+		p90 = Percentile(stats.latencies, 90)
+		p99 = Percentile(stats.latencies, 99)
+		max = stats.latencies[n-1]
+	}
+
+	fmt.Fprintf(os.Stderr, "%v workers: %v files, %v dirs, %v, %vs, %v/s, %.1f iops\n",
+		workersN, stats.files, stats.dirs, formatBytes(uint64(stats.bytes)), sec, formatBytes(uint64(bps)), iops)
+	fmt.Fprintf(os.Stderr, "latencies: p50 %v, p90 %v, p99 %v, max %v\n",
+		p50, p90, p99, max)
+
+	if _, err := fmt.Fprintf(f, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%.1f\t%v\t%v\t%v\t%v\n",
+		workersN, mode, cacheMode(), stats.files, stats.dirs, stats.bytes, sec, uint64(bps),
+		stats.statOps, stats.openOps, stats.readOps, iops,
+		p50.Milliseconds(), p90.Milliseconds(), p99.Milliseconds(), max.Milliseconds()); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing to output file: %v\n", err)
+	}
+
+	return bps
+}
+
+// reportSweepKnee prints the worker count at which the marginal bandwidth
+// gain over the previous step first drops below sweepThreshold.
+func reportSweepKnee(counts []int, bandwidths []float64) {
+	for i := 1; i < len(bandwidths); i++ {
+		if bandwidths[i-1] <= 0 {
+			continue
+		}
+
+		gain := (bandwidths[i] - bandwidths[i-1]) / bandwidths[i-1]
+		if gain < sweepThreshold {
+			fmt.Fprintf(os.Stderr, "knee: %v -> %v workers only gained %.1f%% bandwidth, consider %v workers\n",
+				counts[i-1], counts[i], gain*100, counts[i-1])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "knee: bandwidth kept improving by at least %.1f%% through %v workers\n",
+		sweepThreshold*100, counts[len(counts)-1])
+}
+
 func main() {
+	flag.Parse()
+
+	warnUnsupportedCacheFlags()
+	warnCacheFlagsUnsupportedByBackend()
+
 	if len(flag.Args()) != 1 {
 		fmt.Fprintf(os.Stderr, "usage: parallel-read-benchmark DIR\n")
 		os.Exit(1)
 	}
 
 	dir := flag.Args()[0]
-	fmt.Fprintf(os.Stderr, "traversing %v with %v workers\n", dir, workers)
 
-	f, err := os.OpenFile(outputFile, syscall.O_APPEND, 0644)
+	fsys, err := openBackend(backend, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open backend %v: %v\n", backend, err)
+		os.Exit(1)
+	}
+
+	f, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_APPEND, 0644)
 	if os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "creating output file %v\n", outputFile)
-		err = ioutil.WriteFile(outputFile, []byte("workers\tfiles\tdirs\tbytes\ttime (seconds)\tbandwidth (per second)\n"), 0644)
+		err = ioutil.WriteFile(outputFile, []byte("workers\tmode\tcache\tfiles\tdirs\tbytes\ttime (seconds)\tbandwidth (per second)\tstats\topens\treads\tiops\tp50 (ms)\tp90 (ms)\tp99 (ms)\tmax (ms)\n"), 0644)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error creating output file %v: %v\n", outputFile, err)
 			os.Exit(2)
 		}
 
-		f, err = os.OpenFile(outputFile, syscall.O_APPEND, 0644)
+		f, err = os.OpenFile(outputFile, os.O_WRONLY|os.O_APPEND, 0644)
 	}
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening output file %v: %v\n", outputFile, err)
 	}
 
-	start := time.Now()
-	stats := traverse(workers, dir)
-	sec := float64(time.Since(start)) / float64(time.Second)
-	bps := float64(stats.bytes) / sec
+	if sweep == "" {
+		fmt.Fprintf(os.Stderr, "traversing %v (backend %v) with %v workers in %v mode\n", dir, backend, workers, mode)
+
+		stats, sec, err := runOnce(workers, fsys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		report(f, workers, stats, sec)
+	} else {
+		counts, err := parseSweep(sweep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 
-	fmt.Fprintf(os.Stderr, "%v files, %v dirs, %v, %vs, %v/s\n",
-		stats.files, stats.dirs, formatBytes(uint64(stats.bytes)), sec, formatBytes(uint64(bps)))
+		fmt.Fprintf(os.Stderr, "sweeping %v (backend %v) over worker counts %v in %v mode\n", dir, backend, counts, mode)
 
-	fmt.Fprintf(f, "%v\t%v\t%v\t%v\t%v\t%v\n",
-		workers, stats.files, stats.dirs, stats.bytes, sec, uint64(bps))
+		bandwidths := make([]float64, len(counts))
+		for i, n := range counts {
+			stats, sec, err := runOnce(n, fsys)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			bandwidths[i] = report(f, n, stats, sec)
+		}
+
+		reportSweepKnee(counts, bandwidths)
+	}
 
 	err = f.Close()
 	if err != nil {
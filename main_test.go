@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{
+		1 * time.Millisecond,
+		2 * time.Millisecond,
+		3 * time.Millisecond,
+		4 * time.Millisecond,
+		5 * time.Millisecond,
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{50, 3 * time.Millisecond},
+		{100, 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := Percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("Percentile(sorted, %v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("Percentile(nil, 50) = %v, want 0", got)
+	}
+}
+
+func TestParseSweep(t *testing.T) {
+	counts, err := parseSweep("1, 2,4")
+	if err != nil {
+		t.Fatalf("parseSweep: %v", err)
+	}
+
+	want := []int{1, 2, 4}
+	if len(counts) != len(want) {
+		t.Fatalf("parseSweep(\"1, 2,4\") = %v, want %v", counts, want)
+	}
+
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Fatalf("parseSweep(\"1, 2,4\") = %v, want %v", counts, want)
+		}
+	}
+
+	if _, err := parseSweep("1,x,4"); err == nil {
+		t.Fatal("parseSweep(\"1,x,4\") succeeded, want error")
+	}
+}
+
+func TestCacheMode(t *testing.T) {
+	oldDirect, oldFadvise := direct, fadviseMode
+	defer func() { direct, fadviseMode = oldDirect, oldFadvise }()
+
+	direct, fadviseMode = false, "none"
+	if got := cacheMode(); got != "page-cache" {
+		t.Errorf("cacheMode() = %q, want %q", got, "page-cache")
+	}
+
+	direct, fadviseMode = true, "none"
+	if got := cacheMode(); got != "direct" {
+		t.Errorf("cacheMode() = %q, want %q", got, "direct")
+	}
+
+	direct, fadviseMode = true, "random"
+	if got := cacheMode(); got != "direct+fadvise-random" {
+		t.Errorf("cacheMode() = %q, want %q", got, "direct+fadvise-random")
+	}
+}
+
+// captureStderr runs fn with os.Stderr redirected to a pipe and returns
+// whatever it wrote.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+
+	old := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = old }()
+
+	fn()
+
+	_ = w.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatalf("io.Copy: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestReportSweepKneeFindsKnee(t *testing.T) {
+	oldThreshold := sweepThreshold
+	sweepThreshold = 0.1
+	defer func() { sweepThreshold = oldThreshold }()
+
+	out := captureStderr(t, func() {
+		reportSweepKnee([]int{1, 2, 4}, []float64{100, 200, 205})
+	})
+
+	if !bytes.Contains([]byte(out), []byte("knee: 2 -> 4 workers")) {
+		t.Errorf("reportSweepKnee output = %q, want a knee at 2 -> 4 workers", out)
+	}
+}
+
+func TestReportSweepKneeNoKnee(t *testing.T) {
+	oldThreshold := sweepThreshold
+	sweepThreshold = 0.1
+	defer func() { sweepThreshold = oldThreshold }()
+
+	out := captureStderr(t, func() {
+		reportSweepKnee([]int{1, 2, 4}, []float64{100, 200, 400})
+	})
+
+	if !bytes.Contains([]byte(out), []byte("kept improving")) {
+		t.Errorf("reportSweepKnee output = %q, want no knee reported", out)
+	}
+}
+
+func TestTraverseMapFS(t *testing.T) {
+	fsys := newFixtureMapFS()
+
+	stats, err := traverse(2, fsys, readFile)
+	if err != nil {
+		t.Fatalf("traverse: %v", err)
+	}
+
+	if stats.files != len(fsys) {
+		t.Errorf("stats.files = %v, want %v", stats.files, len(fsys))
+	}
+
+	if stats.bytes != int64(len(fsys))*4096 {
+		t.Errorf("stats.bytes = %v, want %v", stats.bytes, int64(len(fsys))*4096)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressBars renders one live-updating line per worker plus a total line,
+// redrawing in place every time Run's ticker fires.
+type ProgressBars struct {
+	counters []workerCounter
+	total    int
+	done     chan struct{}
+}
+
+type workerCounter struct {
+	files int64
+	bytes int64
+}
+
+// NewProgressBars returns a ProgressBars for the given number of workers.
+// total is the expected number of files to process, used to show a
+// percentage on the total line; pass 0 if unknown.
+func NewProgressBars(workers, total int) *ProgressBars {
+	return &ProgressBars{
+		counters: make([]workerCounter, workers),
+		total:    total,
+		done:     make(chan struct{}),
+	}
+}
+
+// Add records that worker id has just processed a file.
+func (p *ProgressBars) Add(id int, files, bytes int64) {
+	atomic.AddInt64(&p.counters[id].files, files)
+	atomic.AddInt64(&p.counters[id].bytes, bytes)
+}
+
+// Stop ends the rendering loop started by Run.
+func (p *ProgressBars) Stop() {
+	close(p.done)
+}
+
+// Run redraws the progress bars every interval until Stop is called.
+func (p *ProgressBars) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prevFiles := make([]int64, len(p.counters))
+	prevBytes := make([]int64, len(p.counters))
+	prevTime := time.Now()
+	lines := 0
+
+	for {
+		select {
+		case <-p.done:
+			p.render(prevFiles, prevBytes, prevTime, lines)
+			return
+		case now := <-ticker.C:
+			lines = p.render(prevFiles, prevBytes, prevTime, lines)
+			prevTime = now
+			for i := range p.counters {
+				prevFiles[i] = atomic.LoadInt64(&p.counters[i].files)
+				prevBytes[i] = atomic.LoadInt64(&p.counters[i].bytes)
+			}
+		}
+	}
+}
+
+// render redraws all lines in place, overwriting the prevLines previously
+// printed, and returns the number of lines it wrote.
+func (p *ProgressBars) render(prevFiles, prevBytes []int64, prevTime time.Time, prevLines int) int {
+	if prevLines > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dA", prevLines)
+	}
+
+	elapsed := time.Since(prevTime).Seconds()
+
+	var totalFiles, totalBytes int64
+	for i := range p.counters {
+		files := atomic.LoadInt64(&p.counters[i].files)
+		bytes := atomic.LoadInt64(&p.counters[i].bytes)
+		totalFiles += files
+		totalBytes += bytes
+
+		var filesPerSec, bps float64
+		if elapsed > 0 {
+			filesPerSec = float64(files-prevFiles[i]) / elapsed
+			bps = float64(bytes-prevBytes[i]) / elapsed
+		}
+
+		fmt.Fprintf(os.Stderr, "\033[2Kworker %2d: %8.1f files/s, %12v/s\n",
+			i, filesPerSec, formatBytes(uint64(bps)))
+	}
+
+	pct := ""
+	if p.total > 0 {
+		pct = fmt.Sprintf(" (%.1f%%)", 100*float64(totalFiles)/float64(p.total))
+	}
+
+	fmt.Fprintf(os.Stderr, "\033[2Ktotal: %v files%v, %v\n", totalFiles, pct, formatBytes(uint64(totalBytes)))
+
+	return len(p.counters) + 1
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileEntry is a file discovered for the randomio workload, together with
+// its size so offsets can be chosen without re-statting it on every read.
+type fileEntry struct {
+	path string
+	size int64
+}
+
+// discoverFiles walks fsys and returns all regular files at least readSize
+// bytes large, so every ReadAt call below can be satisfied in full.
+func discoverFiles(fsys fs.FS, readSize int) ([]fileEntry, error) {
+	var files []fileEntry
+	err := fs.WalkDir(fsys, ".", func(item string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Size() >= int64(readSize) {
+			files = append(files, fileEntry{path: item, size: info.Size()})
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// randomIOWorker repeatedly issues fixed-size ReadAt calls against files
+// until deadline, following the configured offset pattern.
+func randomIOWorker(wg *sync.WaitGroup, fsys fs.FS, files []fileEntry, readSize int, offsetMode string, deadline time.Time, stats chan<- Stats) {
+	defer wg.Done()
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	buf := make([]byte, readSize)
+
+	idx := rnd.Intn(len(files))
+	var offset int64
+	var f fs.File
+	var ra io.ReaderAt
+	openIdx := -1
+
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	for time.Now().Before(deadline) {
+		fe := files[idx]
+
+		if offsetMode == "random" {
+			idx = rnd.Intn(len(files))
+			fe = files[idx]
+			if max := fe.size - int64(readSize); max > 0 {
+				offset = rnd.Int63n(max)
+			} else {
+				offset = 0
+			}
+		} else if offset+int64(readSize) > fe.size {
+			offset = 0
+			idx = (idx + 1) % len(files)
+			fe = files[idx]
+		}
+
+		if idx != openIdx {
+			if f != nil {
+				_ = f.Close()
+			}
+
+			var err error
+			f, err = fsys.Open(fe.path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unable to open %v: %v\n", fe.path, err)
+				openIdx = -1
+				continue
+			}
+
+			var ok bool
+			ra, ok = f.(io.ReaderAt)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "backend does not support random-access reads for %v\n", fe.path)
+				return
+			}
+
+			openIdx = idx
+		}
+
+		start := time.Now()
+
+		n, err := ra.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			fmt.Fprintf(os.Stderr, "error reading %v at %v: %v\n", fe.path, offset, err)
+			_ = f.Close()
+			f, openIdx = nil, -1
+			continue
+		}
+
+		stats <- Stats{
+			ioOps:     1,
+			bytes:     int64(n),
+			latencies: []time.Duration{time.Since(start)},
+		}
+
+		if offsetMode != "random" {
+			offset += int64(readSize)
+		}
+	}
+}
+
+// benchmarkRandomIO discovers the file set under fsys once, then runs
+// workers concurrent ReadAt loops against it for duration, reporting IOPS.
+func benchmarkRandomIO(workers int, fsys fs.FS, readSize int, offsetMode string, duration time.Duration) (stats Stats, err error) {
+	if readSize <= 0 {
+		return Stats{}, fmt.Errorf("invalid -read-size %v: must be positive", readSize)
+	}
+
+	files, err := discoverFiles(fsys, readSize)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if len(files) == 0 {
+		return Stats{}, fmt.Errorf("no files at least %v bytes large found", readSize)
+	}
+
+	deadline := time.Now().Add(duration)
+
+	var wg sync.WaitGroup
+	statsCh := make(chan Stats, 100)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go randomIOWorker(&wg, fsys, files, readSize, offsetMode, deadline, statsCh)
+	}
+
+	var statsWg sync.WaitGroup
+	statsWg.Add(1)
+	go func() {
+		defer statsWg.Done()
+		for s := range statsCh {
+			stats.Add(s)
+		}
+	}()
+
+	wg.Wait()
+	close(statsCh)
+	statsWg.Wait()
+
+	return stats, nil
+}
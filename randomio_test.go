@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchmarkRandomIOMapFS(t *testing.T) {
+	fsys := newFixtureMapFS()
+
+	stats, err := benchmarkRandomIO(2, fsys, 4096, "random", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("benchmarkRandomIO: %v", err)
+	}
+
+	if stats.ioOps == 0 {
+		t.Error("stats.ioOps = 0, want at least one ReadAt issued")
+	}
+
+	if stats.bytes == 0 {
+		t.Error("stats.bytes = 0, want at least one byte read")
+	}
+}
+
+func TestBenchmarkRandomIORejectsInvalidReadSize(t *testing.T) {
+	fsys := newFixtureMapFS()
+
+	if _, err := benchmarkRandomIO(1, fsys, -1, "sequential", 10*time.Millisecond); err == nil {
+		t.Fatal("benchmarkRandomIO with read-size -1 succeeded, want error")
+	}
+}